@@ -0,0 +1,145 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package auditd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/auditbeat/cmd"
+	"github.com/elastic/go-libaudit/v2/rule"
+	"github.com/elastic/go-libaudit/v2/rule/flags"
+)
+
+func init() {
+	var rulesFile string
+
+	diffRules := cobra.Command{
+		Use:     "auditd-rules-diff",
+		Short:   "Diff a rules file against the rules currently loaded in the kernel",
+		Aliases: []string{"audit-rules-diff", "audit_rules_diff", "rules_diff", "auditdrulesdiff", "auditrulesdiff"},
+		Run: func(cmd *cobra.Command, args []string) {
+			clean, err := diffAuditdRules(rulesFile, os.Stdout)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to diff auditd rules: %v\n", err)
+				os.Exit(1)
+			}
+			if !clean {
+				// Drift found: exit non-zero so this can be used as a CI
+				// or health check gate.
+				os.Exit(1)
+			}
+		},
+	}
+	diffRules.Flags().StringVar(&rulesFile, "file", "", "path to an auditd rules file (auditctl syntax, one rule per line)")
+
+	cmd.RootCmd.AddCommand(&diffRules)
+}
+
+// diffAuditdRules loads rulesFile through the same parser Auditbeat uses
+// to load its configured rules at startup, normalizes both it and the
+// currently loaded kernel rules to auditctl -l syntax, and prints a
+// unified diff of the two. It returns clean=true when there is no drift.
+func diffAuditdRules(rulesFile string, out *os.File) (bool, error) {
+	if rulesFile == "" {
+		return false, errors.New("--file is required")
+	}
+
+	wanted, err := loadConfiguredRules(rulesFile)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to parse rules file")
+	}
+
+	client, err := newAuditClient()
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	rawRules, err := client.GetRules()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to fetch loaded audit rules")
+	}
+
+	loaded := make([]string, 0, len(rawRules))
+	for _, raw := range rawRules {
+		line, err := rule.ToCommandLine(rule.WireFormat(raw), true)
+		if err != nil {
+			return false, errors.Wrap(err, "failed to decode loaded audit rule")
+		}
+		loaded = append(loaded, line)
+	}
+
+	sort.Strings(wanted)
+	sort.Strings(loaded)
+
+	if strings.Join(wanted, "\n") == strings.Join(loaded, "\n") {
+		return true, nil
+	}
+
+	diff := difflib.UnifiedDiff{
+		A:        wanted,
+		B:        loaded,
+		FromFile: rulesFile,
+		ToFile:   "kernel",
+		Context:  3,
+	}
+	text, err := difflib.GetUnifiedDiffString(diff)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to render rule diff")
+	}
+	fmt.Fprint(out, text)
+	return false, nil
+}
+
+// loadConfiguredRules parses an auditctl-syntax rules file the same way
+// Auditbeat parses the `auditd.audit_rules` config setting, and returns
+// each rule re-rendered to its canonical auditctl -l form so it can be
+// compared line-for-line against the kernel's own listing.
+func loadConfiguredRules(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	parsed, err := flags.ParseFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make([]string, 0, len(parsed))
+	for _, r := range parsed {
+		data, err := rule.Build(r)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to build rule %+v", r)
+		}
+		line, err := rule.ToCommandLine(data, true)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
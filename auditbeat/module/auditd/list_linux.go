@@ -0,0 +1,82 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package auditd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/auditbeat/cmd"
+	"github.com/elastic/go-libaudit/v2/rule"
+)
+
+func init() {
+	var asJSON bool
+
+	listRules := cobra.Command{
+		Use:     "auditd-rules-list",
+		Short:   "List currently loaded auditd rules",
+		Aliases: []string{"audit-rules-list", "audit_rules_list", "rules_list", "auditdruleslist", "auditruleslist"},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := listAuditdRules(asJSON); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to list auditd rules: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	listRules.Flags().BoolVar(&asJSON, "json", false, "print rules as JSON instead of auditctl -l syntax")
+
+	cmd.RootCmd.AddCommand(&listRules)
+}
+
+func listAuditdRules(asJSON bool) error {
+	client, err := newAuditClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	rawRules, err := client.GetRules()
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch loaded audit rules")
+	}
+
+	lines := make([]string, 0, len(rawRules))
+	for _, raw := range rawRules {
+		line, err := rule.ToCommandLine(rule.WireFormat(raw), true)
+		if err != nil {
+			return errors.Wrap(err, "failed to decode loaded audit rule")
+		}
+		lines = append(lines, line)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(lines)
+	}
+
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	return nil
+}
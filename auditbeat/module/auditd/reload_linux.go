@@ -0,0 +1,118 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package auditd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/auditbeat/cmd"
+	"github.com/elastic/go-libaudit/v2"
+	"github.com/elastic/go-libaudit/v2/rule"
+	"github.com/elastic/go-libaudit/v2/rule/flags"
+)
+
+func init() {
+	var rulesFile string
+
+	reloadRules := cobra.Command{
+		Use:     "auditd-rules-reload",
+		Short:   "Atomically replace the loaded auditd rules with the contents of a rules file",
+		Aliases: []string{"audit-rules-reload", "audit_rules_reload", "rules_reload", "auditdrulesreload", "auditrulesreload"},
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := reloadAuditdRules(rulesFile); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to reload auditd rules: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	reloadRules.Flags().StringVar(&rulesFile, "file", "", "path to an auditd rules file (auditctl syntax, one rule per line)")
+
+	cmd.RootCmd.AddCommand(&reloadRules)
+}
+
+// reloadAuditdRules replaces the kernel's rule set with the rules parsed
+// from rulesFile under a single critical section: the current rules are
+// snapshotted first, then deleted, then the new rules are added one at a
+// time. If adding any new rule fails, the snapshot is re-added so the
+// kernel is left with its original rules rather than a partial new set.
+func reloadAuditdRules(rulesFile string) error {
+	if rulesFile == "" {
+		return errors.New("--file is required")
+	}
+
+	f, err := os.Open(rulesFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to open rules file")
+	}
+	parsedRules, err := flags.ParseFile(f)
+	f.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed to parse rules file")
+	}
+
+	newRules := make([]rule.WireFormat, 0, len(parsedRules))
+	for _, r := range parsedRules {
+		data, err := rule.Build(r)
+		if err != nil {
+			return errors.Wrapf(err, "failed to build rule %+v", r)
+		}
+		newRules = append(newRules, data)
+	}
+
+	client, err := newAuditClient()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	snapshot, err := client.GetRules()
+	if err != nil {
+		return errors.Wrap(err, "failed to snapshot loaded audit rules")
+	}
+
+	if _, err := client.DeleteRules(); err != nil {
+		return errors.Wrap(err, "failed to delete existing rules")
+	}
+
+	for _, data := range newRules {
+		if err := client.AddRule(data); err != nil {
+			if rbErr := restoreSnapshot(client, snapshot); rbErr != nil {
+				return errors.Wrapf(err, "failed to add new rule, and rollback also failed: %v", rbErr)
+			}
+			return errors.Wrap(err, "failed to add new rule, rolled back to previous rules")
+		}
+	}
+
+	return nil
+}
+
+func restoreSnapshot(client *libaudit.AuditClient, snapshot [][]byte) error {
+	if _, err := client.DeleteRules(); err != nil {
+		return errors.Wrap(err, "failed to clear partially applied rules before rollback")
+	}
+	for _, data := range snapshot {
+		if err := client.AddRule(data); err != nil {
+			return errors.Wrap(err, "failed to re-add a snapshotted rule")
+		}
+	}
+	return nil
+}
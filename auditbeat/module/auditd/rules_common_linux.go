@@ -0,0 +1,56 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package auditd
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/elastic/go-libaudit/v2"
+)
+
+// ErrRulesLocked is returned by the rule management subcommands (list,
+// diff, reload) when the kernel audit rule set is immutable
+// (status.Enabled == 2). Any AddRule/DeleteRules call in that state fails
+// with EPERM, so callers should check for this instead of attempting them.
+type ErrRulesLocked struct{}
+
+func (ErrRulesLocked) Error() string {
+	return "audit rules are locked (enabled == 2); a reboot is required to change them"
+}
+
+// newAuditClient opens an audit netlink client and applies the same guard
+// deleteAuditdRules uses: fail fast with ErrRulesLocked instead of letting
+// a locked rule set surface as an opaque EPERM further down.
+func newAuditClient() (*libaudit.AuditClient, error) {
+	client, err := libaudit.NewAuditClient(nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create audit client")
+	}
+
+	status, err := client.GetStatus()
+	if err != nil {
+		client.Close()
+		return nil, errors.Wrap(err, "failed to get audit status")
+	}
+	if status.Enabled == auditLocked {
+		client.Close()
+		return nil, ErrRulesLocked{}
+	}
+
+	return client, nil
+}
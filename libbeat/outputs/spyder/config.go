@@ -0,0 +1,84 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package spyder
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+// sinkMode selects which destination(s) publishEvent writes encoded events to.
+type sinkMode string
+
+const (
+	sinkFifo    sinkMode = "fifo"
+	sinkJournal sinkMode = "journal"
+	sinkBoth    sinkMode = "both"
+)
+
+type Config struct {
+	Codec  codec.Config `config:"codec"`
+	Pretty bool         `config:"pretty"`
+
+	BatchSize int `config:"batch_size"`
+
+	FifoName string `config:"fifo_name"`
+	FifoSize int    `config:"fifo_size"`
+
+	// Sink selects where events are published: the FIFO named pipe
+	// (default, preserves existing behavior), the systemd journal, or
+	// both.
+	Sink sinkMode `config:"sink"`
+
+	// FifoReopen enables reconnecting to the FIFO with backoff when the
+	// reader side goes away, instead of failing every write with EPIPE
+	// until the output is restarted.
+	FifoReopen bool `config:"fifo_reopen"`
+
+	// HedgeAfter bounds how long a write to the primary FIFO is given to
+	// complete before a concurrent write is also attempted against
+	// FallbackPath. Whichever succeeds first wins; the other is
+	// cancelled. Zero disables hedging.
+	HedgeAfter time.Duration `config:"hedge_after"`
+
+	// FallbackPath is a secondary sink (a plain file or a second FIFO)
+	// used for hedged writes when the primary FIFO is slow or down.
+	FallbackPath string `config:"fallback_path"`
+}
+
+var defaultConfig = Config{
+	Pretty:     false,
+	BatchSize:  2048,
+	FifoSize:   8 * 1024,
+	Sink:       sinkFifo,
+	FifoReopen: true,
+	HedgeAfter: 50 * time.Millisecond,
+}
+
+func (c *Config) Validate() error {
+	switch c.Sink {
+	case sinkFifo, sinkJournal, sinkBoth:
+	case "":
+		c.Sink = sinkFifo
+	default:
+		return fmt.Errorf("spyder.sink must be one of fifo, journal, both, got %q", c.Sink)
+	}
+	return nil
+}
@@ -0,0 +1,321 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package spyder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+)
+
+// fifoQueueSize bounds how many writes may be queued waiting for the
+// writer goroutine before write() starts returning errFifoQueueFull
+// instead of blocking the publisher pipeline indefinitely.
+const fifoQueueSize = 256
+
+const (
+	reopenInitialBackoff = 50 * time.Millisecond
+	reopenMaxBackoff     = 5 * time.Second
+)
+
+var (
+	errFifoClosed    = errors.New("spyder FIFO writer is closed")
+	errFifoQueueFull = errors.New("spyder FIFO write queue is full")
+)
+
+type fifoWriteRequest struct {
+	buf    []byte
+	result chan error
+}
+
+// fifoWriter owns the FIFO named pipe (and an optional fallback sink) on
+// behalf of a single writer goroutine, so Publish never blocks directly on
+// a syscall against a pipe whose reader may have gone away. It reopens the
+// primary FIFO with backoff when the reader disappears, and can hedge a
+// slow primary write against a secondary sink.
+type fifoWriter struct {
+	log *logp.Logger
+
+	path         string
+	fallbackPath string
+	reopen       bool
+	hedgeAfter   time.Duration
+
+	mu       sync.Mutex
+	file     *os.File
+	fallback *os.File
+
+	reqs chan fifoWriteRequest
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newFifoWriter(log *logp.Logger, path, fallbackPath string, reopen bool, hedgeAfter time.Duration) *fifoWriter {
+	w := &fifoWriter{
+		log:          log,
+		path:         path,
+		fallbackPath: fallbackPath,
+		reopen:       reopen,
+		hedgeAfter:   hedgeAfter,
+		reqs:         make(chan fifoWriteRequest, fifoQueueSize),
+		done:         make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w
+}
+
+// open performs the initial open of the primary FIFO, waiting for a reader
+// to be present rather than failing immediately -- like the previous
+// implementation -- but via the same O_NONBLOCK retry-with-backoff loop
+// reopenFIFO uses, rather than a single blocking O_WRONLY open. Using
+// O_NONBLOCK here, and not only on later reopens, is what lets
+// writePrimary bound individual writes with SetWriteDeadline: a plain
+// blocking open's fd can't have its writes interrupted by anything short
+// of the reader draining or disappearing.
+func (w *fifoWriter) open() error {
+	_, err := w.reopenFIFO(context.Background())
+	return err
+}
+
+func (w *fifoWriter) run() {
+	defer w.wg.Done()
+	for {
+		select {
+		case req := <-w.reqs:
+			req.result <- w.hedgedWrite(req.buf)
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// write enqueues buf for the writer goroutine and blocks until it has been
+// written (or failed) so the caller's ACK/Retry decision reflects the
+// outcome. It returns errFifoQueueFull rather than blocking forever when
+// the writer goroutine is stuck reopening the FIFO, so a slow pipe turns
+// into pipeline back-pressure instead of an unbounded queue.
+func (w *fifoWriter) write(buf []byte) error {
+	req := fifoWriteRequest{buf: buf, result: make(chan error, 1)}
+	select {
+	case w.reqs <- req:
+	case <-w.done:
+		return errFifoClosed
+	default:
+		return errFifoQueueFull
+	}
+
+	select {
+	case err := <-req.result:
+		return err
+	case <-w.done:
+		return errFifoClosed
+	}
+}
+
+// hedgedWrite writes buf to the primary FIFO. If HedgeAfter elapses before
+// the primary write completes and a fallback sink is configured, a second
+// write is raced against the primary; the first one to succeed wins and
+// the loser is cancelled via its context rather than left to run
+// unsupervised, so it can never land a stale buffer on a since-reconnected
+// primary out of order with events published after it. Both attempts are
+// tracked in w.wg, so Close() doesn't return while either is still live.
+func (w *fifoWriter) hedgedWrite(buf []byte) error {
+	primaryCtx, cancelPrimary := context.WithCancel(context.Background())
+	defer cancelPrimary()
+
+	primary := make(chan error, 1)
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		primary <- w.writePrimary(primaryCtx, buf)
+	}()
+
+	if w.hedgeAfter <= 0 || w.fallbackPath == "" {
+		return <-primary
+	}
+
+	select {
+	case err := <-primary:
+		return err
+	case <-w.done:
+		cancelPrimary()
+		return <-primary
+	case <-time.After(w.hedgeAfter):
+	}
+
+	fallbackCtx, cancelFallback := context.WithCancel(context.Background())
+	defer cancelFallback()
+
+	fallback := make(chan error, 1)
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		fallback <- w.writeFallback(fallbackCtx, buf)
+	}()
+
+	var primaryErr, fallbackErr error
+	var primaryDone, fallbackDone bool
+	for !primaryDone || !fallbackDone {
+		select {
+		case primaryErr = <-primary:
+			primaryDone = true
+			if primaryErr == nil {
+				cancelFallback()
+				return nil
+			}
+		case fallbackErr = <-fallback:
+			fallbackDone = true
+			if fallbackErr == nil {
+				cancelPrimary()
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("primary and fallback writes both failed: primary=%v, fallback=%v", primaryErr, fallbackErr)
+}
+
+func (w *fifoWriter) writePrimary(ctx context.Context, buf []byte) error {
+	w.mu.Lock()
+	file := w.file
+	w.mu.Unlock()
+
+	if file == nil {
+		if !w.reopen {
+			return errFifoClosed
+		}
+		var err error
+		file, err = w.reopenFIFO(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The race may have been decided against us while we were waiting on
+	// file/reopenFIFO above; don't write this (possibly stale) buffer to
+	// a primary that's only just reconnected.
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// Bound the write itself, not just the reopen backoff above. file is
+	// always opened O_NONBLOCK (see open/reopenFIFO), so a full pipe makes
+	// Go's runtime wait on its poller rather than blocking the OS thread,
+	// and SetWriteDeadline can interrupt that wait. Without this, a reader
+	// that merely stalls rather than disappearing would hang this
+	// goroutine -- and Close's w.wg.Wait() along with it -- for as long as
+	// the reader stays stalled, since ctx cancellation alone cannot
+	// interrupt an in-flight syscall.
+	if w.hedgeAfter > 0 {
+		file.SetWriteDeadline(time.Now().Add(w.hedgeAfter))
+		defer file.SetWriteDeadline(time.Time{})
+	}
+
+	if _, err := file.Write(buf); err != nil {
+		if w.reopen {
+			w.mu.Lock()
+			if w.file == file {
+				w.file.Close()
+				w.file = nil
+			}
+			w.mu.Unlock()
+		}
+		return err
+	}
+	return nil
+}
+
+// reopenFIFO retries O_WRONLY|O_NONBLOCK opens of the primary FIFO with
+// exponential backoff until a reader shows up, the writer is closed, or
+// ctx is cancelled because a hedged write to the fallback already won the
+// race. O_NONBLOCK makes the open fail fast (ENXIO) instead of blocking,
+// which is what lets this loop be interrupted and retried.
+func (w *fifoWriter) reopenFIFO(ctx context.Context) (*os.File, error) {
+	backoff := reopenInitialBackoff
+	for {
+		file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_NONBLOCK, os.ModeNamedPipe)
+		if err == nil {
+			w.mu.Lock()
+			w.file = file
+			w.mu.Unlock()
+			return file, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-w.done:
+			return nil, errFifoClosed
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > reopenMaxBackoff {
+			backoff = reopenMaxBackoff
+		}
+	}
+}
+
+func (w *fifoWriter) writeFallback(ctx context.Context, buf []byte) error {
+	w.mu.Lock()
+	file := w.fallback
+	w.mu.Unlock()
+
+	if file == nil {
+		var err error
+		file, err = os.OpenFile(w.fallbackPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		w.mu.Lock()
+		w.fallback = file
+		w.mu.Unlock()
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	_, err := file.Write(buf)
+	return err
+}
+
+// Close stops the writer goroutine and closes any open file handles.
+func (w *fifoWriter) Close() error {
+	close(w.done)
+	w.wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var firstErr error
+	if w.file != nil {
+		firstErr = w.file.Close()
+	}
+	if w.fallback != nil {
+		if err := w.fallback.Close(); firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
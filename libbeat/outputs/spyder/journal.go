@@ -0,0 +1,137 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package spyder
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/coreos/go-systemd/v22/journal"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+)
+
+// journalFieldLimit is journald's documented limit on the size of a single
+// field value, including its name.
+const journalFieldLimit = 64 * 1024
+
+// journalSink publishes events to the systemd journal via journal.Send,
+// promoting top-level event fields to structured journal fields instead of
+// only shipping the encoded JSON as MESSAGE.
+//
+// go-systemd's sdjournal package is a read-side API (iterating/filtering
+// existing journal entries) and has nothing to offer a writer, so unlike
+// journal it is intentionally not imported here.
+type journalSink struct {
+	index string
+}
+
+func newJournalSink(index string) (*journalSink, error) {
+	if !journal.Enabled() {
+		return nil, errJournalUnavailable
+	}
+	return &journalSink{index: index}, nil
+}
+
+func (j *journalSink) publish(event *beat.Event, encoded []byte) error {
+	fields := map[string]string{
+		"BEAT_INDEX":     j.index,
+		"BEAT_TIMESTAMP": event.Timestamp.Format(tsLayout),
+	}
+	for k, v := range event.Fields.Flatten() {
+		name := journalFieldName(k)
+		if name == "" {
+			continue
+		}
+		fields[name] = truncateField(name, fmt.Sprint(v))
+	}
+
+	return journal.Send(truncateField("MESSAGE", string(encoded)), journalPriority(event), fields)
+}
+
+const tsLayout = "2006-01-02T15:04:05.000Z07:00"
+
+var errJournalUnavailable = journalUnavailableError{}
+
+type journalUnavailableError struct{}
+
+func (journalUnavailableError) Error() string { return "systemd journal is not available" }
+
+// journalFieldName maps an event field name to a valid, stable journald
+// field name: upper-cased, non [A-Z0-9_] runes replaced with '_', and a
+// leading digit or underscore avoided since journald rejects fields that
+// don't start with a letter or underscore followed by a letter/digit.
+func journalFieldName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(name) {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	out := b.String()
+	if out == "" || out[0] == '_' || unicode.IsDigit(rune(out[0])) {
+		out = "F_" + out
+	}
+	return out
+}
+
+func truncateField(name, value string) string {
+	// journald counts the field name, the '=' separator and a trailing
+	// newline against the 64KB limit.
+	budget := journalFieldLimit - len(name) - 2
+	if budget < 0 {
+		budget = 0
+	}
+	if len(value) > budget {
+		return value[:budget]
+	}
+	return value
+}
+
+func journalPriority(event *beat.Event) journal.Priority {
+	// log.level is nested under ECS's "log" object, not a literal
+	// "log.level" key, so it has to be resolved with GetValue rather than
+	// a flat index -- the same reason publish() above flattens fields
+	// before promoting them to journal fields.
+	v, err := event.Fields.GetValue("log.level")
+	if err != nil {
+		return journal.PriInfo
+	}
+	level, ok := v.(string)
+	if !ok {
+		return journal.PriInfo
+	}
+	switch strings.ToLower(level) {
+	case "trace", "debug":
+		return journal.PriDebug
+	case "info":
+		return journal.PriInfo
+	case "warn", "warning":
+		return journal.PriWarning
+	case "error":
+		return journal.PriErr
+	case "critical", "fatal":
+		return journal.PriCrit
+	default:
+		return journal.PriInfo
+	}
+}
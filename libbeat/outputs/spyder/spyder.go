@@ -18,11 +18,10 @@
 package spyder
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	//"golang.org/x/sys/unix"
 	"os"
-	"runtime"
 	//"syscall"
 
 	//"syscall"
@@ -40,14 +39,13 @@ import (
 
 type console struct {
 	log      *logp.Logger
-	out      *os.File
 	observer outputs.Observer
-	writer   *bufio.Writer
 	codec    codec.Codec
 	index    string
-	fifo_name string
-	fifo_size int
-	fifo     *os.File
+
+	sink    sinkMode
+	fifo    *fifoWriter
+	journal *journalSink
 }
 
 type consoleEvent struct {
@@ -86,36 +84,51 @@ func makeSpyder(
 		})
 	}
 
-	fmt.Println(config.FifoName)
-	fmt.Println(config.FifoSize)
-	// Make a FIFO if it doesn't exist
-	if !file_exists(config.FifoName) {
-		fmt.Errorf("FIFO missing! {err}")
-		return outputs.Fail(err)
-	}
-	fmt.Println("ISN!!!! fifo is already there")
-	file, err := os.OpenFile(config.FifoName, os.O_WRONLY, os.ModeNamedPipe)
-	if err != nil {
-		fmt.Errorf("FIFO couldn't be opened! #{err}")
-		return outputs.Fail(err)
-	}
-	fmt.Println("After fifo stuff")
-
 	index := beat.Beat
-	c, err := newSpyder(index, observer, enc, file)
+	c, err := newSpyder(index, observer, enc)
 	if err != nil {
 		return outputs.Fail(fmt.Errorf("console output initialization failed with: %v", err))
 	}
-	c.fifo = file
+	c.sink = config.Sink
+
+	if config.Sink == sinkFifo || config.Sink == sinkBoth {
+		// The FIFO must already exist; it is not created here.
+		if !file_exists(config.FifoName) {
+			err = fmt.Errorf("FIFO missing: %v", config.FifoName)
+			if config.Sink != sinkBoth {
+				return outputs.Fail(err)
+			}
+			c.log.Errorf("spyder FIFO sink unavailable, continuing with journal only: %v", err)
+		} else {
+			fw := newFifoWriter(c.log, config.FifoName, config.FallbackPath, config.FifoReopen, config.HedgeAfter)
+			if err := fw.open(); err != nil {
+				fw.Close()
+				if config.Sink != sinkBoth {
+					return outputs.Fail(fmt.Errorf("FIFO couldn't be opened: %w", err))
+				}
+				c.log.Errorf("spyder FIFO sink unavailable, continuing with journal only: %v", err)
+			} else {
+				c.fifo = fw
+			}
+		}
+	}
 
-	// check stdout actually being available
-	if runtime.GOOS != "windows" {
-		if _, err = c.out.Stat(); err != nil {
-			err = fmt.Errorf("console output initialization failed with: %v", err)
-			return outputs.Fail(err)
+	if config.Sink == sinkJournal || config.Sink == sinkBoth {
+		js, err := newJournalSink(index)
+		if err != nil {
+			if config.Sink != sinkBoth || c.fifo == nil {
+				return outputs.Fail(fmt.Errorf("journal sink unavailable: %w", err))
+			}
+			c.log.Errorf("spyder journal sink unavailable, continuing with FIFO only: %v", err)
+		} else {
+			c.journal = js
 		}
 	}
 
+	if c.fifo == nil && c.journal == nil {
+		return outputs.Fail(errors.New("spyder output has no usable sink"))
+	}
+
 	return outputs.Success(config.BatchSize, 0, c)
 }
 
@@ -127,32 +140,41 @@ func file_exists(filename string) bool {
 	return !info.IsDir()
 }
 
-func newSpyder(index string, observer outputs.Observer, codec codec.Codec, fifo *os.File) (*console, error) {
-	c := &console{log: logp.NewLogger("console"), out: fifo, codec: codec, observer: observer, index: index}
-	c.writer = bufio.NewWriterSize(c.out, 8*1024)
+func newSpyder(index string, observer outputs.Observer, codec codec.Codec) (*console, error) {
+	c := &console{log: logp.NewLogger("console"), codec: codec, observer: observer, index: index}
 	return c, nil
 }
 
-func (c *console) Close() error { return nil }
+func (c *console) Close() error {
+	if c.fifo != nil {
+		return c.fifo.Close()
+	}
+	return nil
+}
+
 func (c *console) Publish(batch publisher.Batch) error {
 	st := c.observer
 	events := batch.Events()
 	st.NewBatch(len(events))
 
+	var failed []publisher.Event
 	dropped := 0
 	for i := range events {
-		ok := c.publishEvent(&events[i])
-		if !ok {
+		if !c.publishEvent(&events[i]) {
 			dropped++
+			failed = append(failed, events[i])
 		}
 	}
 
-	c.writer.Flush()
-	batch.ACK()
-
 	st.Dropped(dropped)
 	st.Acked(len(events) - dropped)
 
+	if len(failed) > 0 {
+		batch.RetryEvents(failed)
+		return fmt.Errorf("spyder output failed to publish %d/%d events", len(failed), len(events))
+	}
+
+	batch.ACK()
 	return nil
 }
 
@@ -170,15 +192,27 @@ func (c *console) publishEvent(event *publisher.Event) bool {
 		return false
 	}
 
-	if err := c.writeBuffer(serializedEvent); err != nil {
-		c.observer.WriteError(err)
-		c.log.Errorf("Unable to publish events to console: %+v", err)
-		return false
+	var fifoOK, journalOK bool
+
+	if c.fifo != nil && (c.sink == sinkFifo || c.sink == sinkBoth) {
+		if err := c.fifo.write(append(append([]byte(nil), serializedEvent...), nl...)); err != nil {
+			c.observer.WriteError(err)
+			c.log.Errorf("Unable to publish event to spyder FIFO: %+v", err)
+		} else {
+			fifoOK = true
+		}
 	}
 
-	if err := c.writeBuffer(nl); err != nil {
-		c.observer.WriteError(err)
-		c.log.Errorf("Error when appending newline to event: %+v", err)
+	if c.journal != nil && (c.sink == sinkJournal || c.sink == sinkBoth) {
+		if err := c.journal.publish(&event.Content, serializedEvent); err != nil {
+			c.observer.WriteError(err)
+			c.log.Errorf("Unable to publish event to systemd journal: %+v", err)
+		} else {
+			journalOK = true
+		}
+	}
+
+	if !fifoOK && !journalOK {
 		return false
 	}
 
@@ -186,19 +220,6 @@ func (c *console) publishEvent(event *publisher.Event) bool {
 	return true
 }
 
-func (c *console) writeBuffer(buf []byte) error {
-	written := 0
-	for written < len(buf) {
-		n, err := c.writer.Write(buf[written:])
-		if err != nil {
-			return err
-		}
-
-		written += n
-	}
-	return nil
-}
-
 func (c *console) String() string {
 	return "spyder"
 }
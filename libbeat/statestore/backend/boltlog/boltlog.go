@@ -0,0 +1,266 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package boltlog implements the statestore backend.Store/backend.Registry
+// interfaces on top of a single bbolt database file per registry, with one
+// bucket per store and one key per input ID. It is a drop-in alternative to
+// memlog for deployments with large cursor sets, where memlog's full-file
+// checkpoint rewrite becomes the dominant IO cost.
+package boltlog
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+)
+
+// Registry configures access to bbolt backed stores. All stores opened
+// through a single Registry share the same underlying bbolt.DB file; each
+// store is a separate bucket within that file.
+type Registry struct {
+	log *logp.Logger
+
+	// mu guards active and db. Store methods take a read lock for the
+	// duration of their transaction so a concurrent Compact (which takes
+	// the write lock while it closes and swaps r.db) can never run
+	// underneath an in-flight Get/Set/Each/Remove.
+	mu     sync.RWMutex
+	active bool
+	db     *bbolt.DB
+
+	settings Settings
+
+	wg sync.WaitGroup
+}
+
+// CheckpointPredicate decides, given the number of bytes a store has
+// written since the predicate last returned true, whether the current write
+// commits in its own db.Update transaction instead of joining a db.Batch.
+// Writes already queued in a batch are not flushed by it. It is the boltlog
+// analogue of memlog.CheckpointPredicate; backend does not export a shared
+// type for this, so each backend defines its own.
+type CheckpointPredicate func(pending uint64) bool
+
+// Settings configures a new Registry.
+type Settings struct {
+	// Path to the bbolt database file backing the registry. Unlike memlog,
+	// all stores share one file.
+	Path string `config:"path"`
+
+	// FileMode is used to configure the file mode for the database file.
+	// File mode 0600 will be used if this field is not set.
+	FileMode os.FileMode `config:"file_mode"`
+
+	// Checkpoint predicate evaluated on each Set against the size (in
+	// bytes) of the values written since it last returned true. When it
+	// returns true, that write commits in its own db.Update transaction and
+	// the count restarts; otherwise the write goes through db.Batch. It
+	// does not change when a db.Batch commits (see BatchTimeout). Not
+	// configurable from YAML since it's a function value; callers set it
+	// programmatically.
+	Checkpoint CheckpointPredicate
+
+	// OpenTimeout bounds how long bbolt.Open waits to acquire the
+	// database file's flock before giving up. It is unset (block
+	// forever, matching bbolt's own default) unless configured, since a
+	// momentarily held lock during a crash-restart race should not be
+	// treated as a fatal error.
+	OpenTimeout time.Duration `config:"open_timeout"`
+
+	// BatchTimeout bounds how long a pending write batch is held open
+	// before being flushed, regardless of Checkpoint. Maps directly onto
+	// bbolt's db.MaxBatchDelay and defaults to bbolt's own default if not
+	// set; unlike OpenTimeout it has no effect on bbolt.Open.
+	BatchTimeout time.Duration `config:"batch_timeout"`
+}
+
+const defaultFileMode os.FileMode = 0600
+
+// New configures a bbolt backed Registry that can be used to open stores.
+// The database file at settings.Path is created if it does not exist.
+func New(log *logp.Logger, settings Settings) (*Registry, error) {
+	if settings.FileMode == 0 {
+		settings.FileMode = defaultFileMode
+	}
+	if settings.Checkpoint == nil {
+		settings.Checkpoint = defaultCheckpoint
+	}
+
+	path, err := filepath.Abs(settings.Path)
+	if err != nil {
+		return nil, err
+	}
+	settings.Path = path
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+
+	opts := *bbolt.DefaultOptions
+	if settings.OpenTimeout > 0 {
+		opts.Timeout = settings.OpenTimeout
+	}
+	db, err := bbolt.Open(path, settings.FileMode, &opts)
+	if err != nil {
+		return nil, err
+	}
+	if settings.BatchTimeout > 0 {
+		db.MaxBatchDelay = settings.BatchTimeout
+	}
+
+	return &Registry{
+		log:      log,
+		active:   true,
+		db:       db,
+		settings: settings,
+	}, nil
+}
+
+func defaultCheckpoint(pending uint64) bool {
+	const limit = 1 * 1 << 20 // flush every 1MB of pending writes by default
+	return pending >= limit
+}
+
+// view runs fn in a read-only bbolt transaction against the registry's
+// current db, holding r.mu for the duration so Compact cannot close or
+// swap it out from underneath fn.
+func (r *Registry) view(fn func(*bbolt.Tx) error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.active {
+		return errRegClosed
+	}
+	return r.db.View(fn)
+}
+
+// update runs fn in a read-write bbolt transaction, with the same
+// Compact-safety as view.
+func (r *Registry) update(fn func(*bbolt.Tx) error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.active {
+		return errRegClosed
+	}
+	return r.db.Update(fn)
+}
+
+// batch runs fn via bbolt's db.Batch, with the same Compact-safety as
+// view.
+func (r *Registry) batch(fn func(*bbolt.Tx) error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.active {
+		return errRegClosed
+	}
+	return r.db.Batch(fn)
+}
+
+// Access creates or opens a new store. A new bucket is created for the
+// store if it does not already exist.
+func (r *Registry) Access(name string) (backend.Store, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.active {
+		return nil, errRegClosed
+	}
+
+	if err := r.db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(name))
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	logger := r.log.With("store", name)
+	return newStore(logger, r, name, r.settings.Checkpoint), nil
+}
+
+// Compact forces bbolt to reclaim free pages left behind by deleted or
+// overwritten keys by rewriting the database into a fresh file and swapping
+// it in. It is safe to call while stores are open but blocks all access
+// for its duration.
+func (r *Registry) Compact() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.active {
+		return errRegClosed
+	}
+
+	tmpPath := r.settings.Path + ".compact"
+	tmp, err := bbolt.Open(tmpPath, r.settings.FileMode, nil)
+	if err != nil {
+		return err
+	}
+
+	err = r.db.View(func(srcTx *bbolt.Tx) error {
+		return tmp.Update(func(dstTx *bbolt.Tx) error {
+			return srcTx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+				dst, err := dstTx.CreateBucketIfNotExists(name)
+				if err != nil {
+					return err
+				}
+				return b.ForEach(func(k, v []byte) error {
+					return dst.Put(k, v)
+				})
+			})
+		})
+	})
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := r.db.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, r.settings.Path); err != nil {
+		return err
+	}
+
+	db, err := bbolt.Open(r.settings.Path, r.settings.FileMode, nil)
+	if err != nil {
+		return err
+	}
+	r.db = db
+	return nil
+}
+
+// Close closes the registry. No new store can be accessed during close.
+// Close blocks until all stores have been closed.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	r.active = false
+	r.mu.Unlock()
+
+	r.wg.Wait()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.db.Close()
+}
@@ -0,0 +1,50 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Command migrate copies an existing memlog registry into a new bbolt
+// registry file, so a beat can switch its `registry.type` from memlog to
+// bbolt without losing cursor state.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/boltlog"
+)
+
+func main() {
+	memlogRoot := flag.String("memlog-root", "", "path to the existing memlog registry directory")
+	boltPath := flag.String("bolt-path", "", "path of the bbolt registry file to create")
+	stores := flag.String("stores", "", "comma separated list of store names (input registry names) to migrate")
+	flag.Parse()
+
+	if *memlogRoot == "" || *boltPath == "" || *stores == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	log := logp.NewLogger("boltlog-migrate")
+	names := strings.Split(*stores, ",")
+	if err := boltlog.MigrateFromMemlog(log, *memlogRoot, *boltPath, names); err != nil {
+		fmt.Fprintf(os.Stderr, "migration failed: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,93 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package boltlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+)
+
+// MigrateFromMemlog reads the stores named in storeNames from an existing
+// memlog registry rooted at memlogRoot and replays their keys into the bbolt file at
+// boltPath, creating it if necessary. It is meant to be run once, offline,
+// so deployments can switch a running beat's registry backend from memlog
+// to bbolt without losing cursors.
+//
+// storeNames lists the store sub-directories to migrate (matching the
+// per-input store names memlog.Registry.Access is normally called with).
+// Stores not present in memlogRoot are skipped.
+func MigrateFromMemlog(log *logp.Logger, memlogRoot, boltPath string, storeNames []string) error {
+	src, err := memlog.New(log, memlog.Settings{Root: memlogRoot})
+	if err != nil {
+		return fmt.Errorf("failed to open memlog registry at %v: %w", memlogRoot, err)
+	}
+	defer src.Close()
+
+	dst, err := New(log, Settings{Path: boltPath})
+	if err != nil {
+		return fmt.Errorf("failed to open bbolt registry at %v: %w", boltPath, err)
+	}
+	defer dst.Close()
+
+	for _, name := range storeNames {
+		if _, err := os.Stat(filepath.Join(memlogRoot, name)); os.IsNotExist(err) {
+			continue
+		}
+		if err := migrateStore(src, dst, name); err != nil {
+			return fmt.Errorf("failed to migrate store %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func migrateStore(src *memlog.Registry, dst *Registry, name string) error {
+	srcStore, err := src.Access(name)
+	if err != nil {
+		return err
+	}
+	defer srcStore.Close()
+
+	dstStore, err := dst.Access(name)
+	if err != nil {
+		return err
+	}
+	defer dstStore.Close()
+
+	// Decode into json.RawMessage rather than interface{}: RawMessage's
+	// UnmarshalJSON just captures the original bytes verbatim, so
+	// numeric fields (e.g. nanosecond timestamps or offsets near/above
+	// 2^53) survive the hop instead of being rounded through float64.
+	// Set below then writes those bytes straight through, since
+	// json.Marshal on a RawMessage is also a no-op copy.
+	return srcStore.Each(func(key string, dec backend.ValueDecoder) (bool, error) {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return false, err
+		}
+		if err := dstStore.Set(key, raw); err != nil {
+			return false, err
+		}
+		return true, nil
+	})
+}
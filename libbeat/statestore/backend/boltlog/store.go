@@ -0,0 +1,179 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package boltlog
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+)
+
+var errRegClosed = errors.New("registry is being closed")
+var errStoreClosed = errors.New("store is being closed")
+
+// store implements backend.Store on top of a single bucket of the
+// Registry's shared bbolt.DB. Keys are input IDs; values are the
+// JSON-encoded state.
+type store struct {
+	log        *logp.Logger
+	reg        *Registry
+	bucket     string
+	checkpoint CheckpointPredicate
+
+	mu      sync.Mutex
+	closed  bool
+	pending uint64
+}
+
+func newStore(log *logp.Logger, reg *Registry, bucket string, checkpoint CheckpointPredicate) *store {
+	reg.wg.Add(1)
+	return &store{log: log, reg: reg, bucket: bucket, checkpoint: checkpoint}
+}
+
+// Close marks the store as closed. The underlying bbolt.DB is only closed
+// when the owning Registry is closed, as it is shared between stores.
+func (s *store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.reg.wg.Done()
+	return nil
+}
+
+// Each iterates all keys in the store's bucket, decoding each value lazily
+// via fn. Iteration stops early if fn returns false or an error.
+func (s *store) Each(fn func(string, backend.ValueDecoder) (bool, error)) error {
+	err := s.reg.view(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(s.bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			cont, err := fn(string(k), jsonDecoder(v))
+			if err != nil {
+				return err
+			}
+			if !cont {
+				return errStopIteration
+			}
+			return nil
+		})
+	})
+	if err == errStopIteration {
+		return nil
+	}
+	return err
+}
+
+// Has reports whether key exists in the store.
+func (s *store) Has(key string) (bool, error) {
+	var found bool
+	err := s.reg.view(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(s.bucket))
+		if b == nil {
+			return nil
+		}
+		found = b.Get([]byte(key)) != nil
+		return nil
+	})
+	return found, err
+}
+
+// Get reads and decodes key's value into into.
+func (s *store) Get(key string, into interface{}) error {
+	var raw []byte
+	err := s.reg.view(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(s.bucket))
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		raw = append([]byte(nil), v...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if raw == nil {
+		return backend.ErrKeyUnknown
+	}
+	return json.Unmarshal(raw, into)
+}
+
+// Set encodes from and writes it to key. Writes go through bbolt's
+// db.Batch so that concurrent Set calls across goroutines are coalesced
+// into a single fsync, except that once the configured CheckpointPredicate
+// trips, that one write commits in its own db.Update transaction instead.
+// Writes already queued in a batch are not flushed early.
+func (s *store) Set(key string, from interface{}) error {
+	raw, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+
+	write := func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(s.bucket))
+		if b == nil {
+			var err error
+			b, err = tx.CreateBucketIfNotExists([]byte(s.bucket))
+			if err != nil {
+				return err
+			}
+		}
+		return b.Put([]byte(key), raw)
+	}
+
+	pending := atomic.AddUint64(&s.pending, uint64(len(raw)))
+	if s.checkpoint != nil && s.checkpoint(pending) {
+		atomic.StoreUint64(&s.pending, 0)
+		return s.reg.update(write)
+	}
+	return s.reg.batch(write)
+}
+
+// Remove deletes key from the store. It is not an error to remove a key
+// that does not exist.
+func (s *store) Remove(key string) error {
+	return s.reg.update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte(s.bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+type jsonDecoder []byte
+
+func (d jsonDecoder) Decode(to interface{}) error {
+	return json.Unmarshal(d, to)
+}
+
+var errStopIteration = errors.New("stop iteration")
@@ -0,0 +1,58 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package statestore
+
+import (
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/logp"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/boltlog"
+	"github.com/elastic/beats/v7/libbeat/statestore/backend/memlog"
+)
+
+// BackendConfig selects and configures the backend.Registry used to store a
+// beat's registry. The zero value selects the memlog backend for backwards
+// compatibility with existing deployments.
+type BackendConfig struct {
+	// Type selects the backend implementation. One of "memlog" (default)
+	// or "bbolt".
+	Type string `config:"type"`
+
+	Memlog memlog.Settings  `config:",inline"`
+	Bbolt  boltlog.Settings `config:",inline"`
+}
+
+const (
+	backendMemlog = "memlog"
+	backendBbolt  = "bbolt"
+)
+
+// NewBackend builds the backend.Registry selected by cfg. Inputs only ever
+// see the backend.Store/backend.Registry interfaces, so switching between
+// memlog and bbolt is transparent to them.
+func NewBackend(log *logp.Logger, cfg BackendConfig) (backend.Registry, error) {
+	switch cfg.Type {
+	case "", backendMemlog:
+		return memlog.New(log, cfg.Memlog)
+	case backendBbolt:
+		return boltlog.New(log, cfg.Bbolt)
+	default:
+		return nil, fmt.Errorf("unknown registry backend type %q", cfg.Type)
+	}
+}